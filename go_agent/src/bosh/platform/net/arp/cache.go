@@ -0,0 +1,13 @@
+package arp
+
+// Cache tracks the kernel's current IP<->MAC neighbor bindings so callers
+// can check them without shelling out on every lookup.
+type Cache interface {
+	// Lookup returns the MAC address and interface currently associated
+	// with ip, refreshing the underlying neighbor table first if it is
+	// stale.
+	Lookup(ip string) (mac string, iface string, err error)
+
+	// Neighbors returns every neighbor currently known to the cache.
+	Neighbors() []Neighbor
+}
@@ -0,0 +1,9 @@
+package arp
+
+// Neighbor is a single IP-to-MAC binding as reported by the kernel's
+// neighbor (ARP) table.
+type Neighbor struct {
+	Ip        string
+	Mac       string
+	Interface string
+}
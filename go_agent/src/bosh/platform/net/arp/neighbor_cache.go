@@ -0,0 +1,172 @@
+package arp
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	bosherr "bosh/errors"
+	boshsys "bosh/system"
+)
+
+var (
+	ipNeighShowRegex = regexp.MustCompile(`^(\S+)\s+dev\s+(\S+)\s+lladdr\s+(\S+)`)
+	procNetArpRegex  = regexp.MustCompile(`^(\S+)\s+\S+\s+\S+\s+(\S+)\s+\S+\s+(\S+)\s*$`)
+)
+
+// neighborCache maintains a periodically-refreshed view of the kernel's
+// neighbor table, built by parsing `ip neigh show` (falling back to
+// /proc/net/arp on hosts where the `ip` binary is unavailable). Refreshes
+// are coalesced so many goroutines can call Lookup concurrently without
+// each one shelling out.
+type neighborCache struct {
+	cmdRunner boshsys.CmdRunner
+	fs        boshsys.FileSystem
+	ttl       time.Duration
+
+	mu          sync.Mutex
+	fetchedAt   time.Time
+	hasFetched  bool
+	neighbors   map[string]Neighbor
+	refreshing  bool
+	refreshDone chan struct{}
+}
+
+func NewNeighborCache(cmdRunner boshsys.CmdRunner, fs boshsys.FileSystem, ttl time.Duration) *neighborCache {
+	return &neighborCache{
+		cmdRunner: cmdRunner,
+		fs:        fs,
+		ttl:       ttl,
+		neighbors: map[string]Neighbor{},
+	}
+}
+
+func (c *neighborCache) Lookup(ip string) (mac string, iface string, err error) {
+	err = c.refreshIfStale()
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	neighbor, found := c.neighbors[ip]
+	if !found {
+		err = bosherr.New("No neighbor entry found for IP '%s'", ip)
+		return
+	}
+
+	return neighbor.Mac, neighbor.Interface, nil
+}
+
+func (c *neighborCache) Neighbors() []Neighbor {
+	err := c.refreshIfStale()
+	if err != nil {
+		return []Neighbor{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	neighbors := make([]Neighbor, 0, len(c.neighbors))
+	for _, neighbor := range c.neighbors {
+		neighbors = append(neighbors, neighbor)
+	}
+
+	return neighbors
+}
+
+// refreshIfStale fetches a new neighbor table when the cached one has
+// expired. Concurrent callers that arrive while a refresh is already in
+// flight wait on it instead of starting a redundant one.
+func (c *neighborCache) refreshIfStale() error {
+	c.mu.Lock()
+
+	if c.refreshing {
+		done := c.refreshDone
+		c.mu.Unlock()
+		<-done
+		return nil
+	}
+
+	if c.hasFetched && time.Since(c.fetchedAt) < c.ttl {
+		c.mu.Unlock()
+		return nil
+	}
+
+	c.refreshing = true
+	c.refreshDone = make(chan struct{})
+	c.mu.Unlock()
+
+	neighbors, err := c.fetchNeighbors()
+
+	c.mu.Lock()
+	if err == nil {
+		c.neighbors = neighbors
+		c.fetchedAt = time.Now()
+		c.hasFetched = true
+	}
+	c.refreshing = false
+	close(c.refreshDone)
+	c.mu.Unlock()
+
+	return err
+}
+
+func (c *neighborCache) fetchNeighbors() (map[string]Neighbor, error) {
+	stdout, _, err := c.cmdRunner.RunCommand("ip", "neigh", "show")
+	if err == nil {
+		return c.parseIpNeighShow(stdout), nil
+	}
+
+	contents, readErr := c.fs.ReadFileString("/proc/net/arp")
+	if readErr != nil {
+		return nil, bosherr.WrapError(err, "Shelling out to ip neigh show")
+	}
+
+	return c.parseProcNetArp(contents), nil
+}
+
+func (c *neighborCache) parseIpNeighShow(stdout string) map[string]Neighbor {
+	neighbors := map[string]Neighbor{}
+
+	for _, line := range strings.Split(stdout, "\n") {
+		matches := ipNeighShowRegex.FindStringSubmatch(strings.TrimSpace(line))
+		if matches == nil {
+			continue
+		}
+
+		neighbors[matches[1]] = Neighbor{
+			Ip:        matches[1],
+			Interface: matches[2],
+			Mac:       matches[3],
+		}
+	}
+
+	return neighbors
+}
+
+func (c *neighborCache) parseProcNetArp(contents string) map[string]Neighbor {
+	neighbors := map[string]Neighbor{}
+
+	lines := strings.Split(contents, "\n")
+	if len(lines) > 0 {
+		lines = lines[1:] // skip header
+	}
+
+	for _, line := range lines {
+		matches := procNetArpRegex.FindStringSubmatch(strings.TrimSpace(line))
+		if matches == nil {
+			continue
+		}
+
+		neighbors[matches[1]] = Neighbor{
+			Ip:        matches[1],
+			Mac:       matches[2],
+			Interface: matches[3],
+		}
+	}
+
+	return neighbors
+}
@@ -0,0 +1,139 @@
+package arp
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeCmdRunner struct {
+	stub      func(cmd string, args ...string) (string, string, error)
+	callCount int32
+}
+
+func (r *fakeCmdRunner) RunCommand(cmd string, args ...string) (string, string, error) {
+	atomic.AddInt32(&r.callCount, 1)
+	return r.stub(cmd, args...)
+}
+
+type fakeFileSystem struct {
+	filesToRead map[string]string
+}
+
+func (fs *fakeFileSystem) FileExists(path string) bool { return false }
+
+func (fs *fakeFileSystem) Glob(pattern string) ([]string, error) { return nil, nil }
+
+func (fs *fakeFileSystem) ReadFileString(path string) (string, error) {
+	return fs.filesToRead[path], nil
+}
+
+func (fs *fakeFileSystem) WriteFile(path string, content []byte) error { return nil }
+
+func (fs *fakeFileSystem) ConvergeFileContents(path string, content []byte) (bool, error) {
+	return false, nil
+}
+
+func TestNeighborCacheCoalescesConcurrentRefreshes(t *testing.T) {
+	cmdRunner := &fakeCmdRunner{
+		stub: func(cmd string, args ...string) (string, string, error) {
+			time.Sleep(20 * time.Millisecond)
+			return "10.0.0.5 dev eth0 lladdr 00:11:22:33:44:55 REACHABLE", "", nil
+		},
+	}
+
+	cache := NewNeighborCache(cmdRunner, &fakeFileSystem{}, time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			mac, iface, err := cache.Lookup("10.0.0.5")
+			assert.NoError(t, err)
+			assert.Equal(t, "00:11:22:33:44:55", mac)
+			assert.Equal(t, "eth0", iface)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&cmdRunner.callCount))
+}
+
+func TestNeighborCacheRefreshesAfterTTLExpires(t *testing.T) {
+	cmdRunner := &fakeCmdRunner{
+		stub: func(cmd string, args ...string) (string, string, error) {
+			return "10.0.0.5 dev eth0 lladdr 00:11:22:33:44:55 REACHABLE", "", nil
+		},
+	}
+
+	cache := NewNeighborCache(cmdRunner, &fakeFileSystem{}, time.Millisecond)
+
+	_, _, err := cache.Lookup("10.0.0.5")
+	assert.NoError(t, err)
+
+	time.Sleep(5 * time.Millisecond)
+
+	_, _, err = cache.Lookup("10.0.0.5")
+	assert.NoError(t, err)
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&cmdRunner.callCount))
+}
+
+func TestNeighborCacheRespectsTTLWhenNeighborTableIsEmpty(t *testing.T) {
+	cmdRunner := &fakeCmdRunner{
+		stub: func(cmd string, args ...string) (string, string, error) {
+			return "", "", nil
+		},
+	}
+
+	cache := NewNeighborCache(cmdRunner, &fakeFileSystem{}, time.Minute)
+
+	_, _, err := cache.Lookup("10.0.0.5")
+	assert.Error(t, err)
+
+	_, _, err = cache.Lookup("10.0.0.5")
+	assert.Error(t, err)
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&cmdRunner.callCount))
+}
+
+func TestNeighborCacheFallsBackToProcNetArp(t *testing.T) {
+	cmdRunner := &fakeCmdRunner{
+		stub: func(cmd string, args ...string) (string, string, error) {
+			return "", "", errors.New("ip: command not found")
+		},
+	}
+
+	fs := &fakeFileSystem{
+		filesToRead: map[string]string{
+			"/proc/net/arp": "IP address       HW type     Flags       HW address            Mask     Device\n" +
+				"10.0.0.5         0x1         0x2         00:11:22:33:44:55     *        eth0\n",
+		},
+	}
+
+	cache := NewNeighborCache(cmdRunner, fs, time.Minute)
+
+	mac, iface, err := cache.Lookup("10.0.0.5")
+	assert.NoError(t, err)
+	assert.Equal(t, "00:11:22:33:44:55", mac)
+	assert.Equal(t, "eth0", iface)
+}
+
+func TestNeighborCacheLookupMissReturnsError(t *testing.T) {
+	cmdRunner := &fakeCmdRunner{
+		stub: func(cmd string, args ...string) (string, string, error) {
+			return "10.0.0.5 dev eth0 lladdr 00:11:22:33:44:55 REACHABLE", "", nil
+		},
+	}
+
+	cache := NewNeighborCache(cmdRunner, &fakeFileSystem{}, time.Minute)
+
+	_, _, err := cache.Lookup("10.0.0.9")
+	assert.Error(t, err)
+}
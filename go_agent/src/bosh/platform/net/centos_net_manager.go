@@ -2,52 +2,117 @@ package net
 
 import (
 	bosherr "bosh/errors"
+	boshlog "bosh/logger"
+	bosharp "bosh/platform/net/arp"
+	boship "bosh/platform/net/ip"
 	boshsettings "bosh/settings"
 	boshsys "bosh/system"
 	"bytes"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"text/template"
 	"time"
 )
 
+const centosNetManagerLogTag = "centosNetManager"
+
 type centos struct {
 	arpWaitInterval time.Duration
 	cmdRunner       boshsys.CmdRunner
 	fs              boshsys.FileSystem
+	arpCache        bosharp.Cache
+	logger          boshlog.Logger
+}
+
+// StaticInterfaceConfiguration captures the resolved, host-specific details
+// for a network that the director assigned a static IP to.
+type StaticInterfaceConfiguration struct {
+	Name              string
+	Network           string
+	Netmask           string
+	Broadcast         string
+	Ip                string
+	Gateway           string
+	HasDefaultGateway bool
+	Mac               string
+}
+
+// DHCPInterfaceConfiguration identifies an interface that should be brought
+// up over DHCP -- either because the director configured it that way, or
+// because it is present on the host but unmentioned in settings.
+type DHCPInterfaceConfiguration struct {
+	Name string
+	Mac  string
 }
 
+const neighborCacheTTL = 10 * time.Second
+
 func NewCentosNetManager(
 	fs boshsys.FileSystem,
 	cmdRunner boshsys.CmdRunner,
 	arpWaitInterval time.Duration,
+	logger boshlog.Logger,
 ) (net centos) {
 	net.arpWaitInterval = arpWaitInterval
 	net.cmdRunner = cmdRunner
 	net.fs = fs
+	net.arpCache = bosharp.NewNeighborCache(cmdRunner, fs, neighborCacheTTL)
+	net.logger = logger
 	return
 }
 
 func (net centos) getDnsServers(networks boshsettings.Networks) (dnsServers []string) {
 	dnsNetwork, found := networks.DefaultNetworkFor("dns")
 	if found {
-		for i := len(dnsNetwork.Dns) - 1; i >= 0; i-- {
-			dnsServers = append(dnsServers, dnsNetwork.Dns[i])
-		}
+		dnsServers = dnsNetwork.Dns
 	}
 
 	return
 }
 
-func (net centos) SetupDhcp(networks boshsettings.Networks) (err error) {
-	dnsServers := []string{}
-	dnsNetwork, found := networks.DefaultNetworkFor("dns")
-	if found {
-		for i := len(dnsNetwork.Dns) - 1; i >= 0; i-- {
-			dnsServers = append(dnsServers, dnsNetwork.Dns[i])
+// SetupNetworking configures the host's interfaces in one pass -- networks
+// the director gave a static IP get BOOTPROTO=static ifcfg files, networks
+// configured for DHCP (or physical interfaces the director never mentioned)
+// get BOOTPROTO=dhcp ones -- so static and DHCP interfaces can be mixed on
+// the same host.
+func (net centos) SetupNetworking(networks boshsettings.Networks) (err error) {
+	staticConfigs, dhcpConfigs, err := net.buildInterfaceConfigurations(networks)
+	if err != nil {
+		err = bosherr.WrapError(err, "Building interface configurations")
+		return
+	}
+
+	interfaceAddresses, err := net.writeIfcfgs(staticConfigs, dhcpConfigs)
+	if err != nil {
+		err = bosherr.WrapError(err, "Writing network interfaces")
+		return
+	}
+
+	if len(dhcpConfigs) > 0 {
+		err = net.writeDhclientConf(networks)
+		if err != nil {
+			err = bosherr.WrapError(err, "Writing dhclient configuration")
+			return
 		}
 	}
 
+	net.restartNetwork()
+
+	err = net.writeResolvConf(networks)
+	if err != nil {
+		err = bosherr.WrapError(err, "Writing resolv.conf")
+		return
+	}
+
+	go net.gratuitiousArp(interfaceAddresses)
+
+	return
+}
+
+func (net centos) writeDhclientConf(networks boshsettings.Networks) (err error) {
+	dnsServers := net.getDnsServers(networks)
+
 	type dhcpConfigArg struct {
 		DnsServers []string
 	}
@@ -61,17 +126,12 @@ func (net centos) SetupDhcp(networks boshsettings.Networks) (err error) {
 		return
 	}
 
-	written, err := net.fs.ConvergeFileContents("/etc/dhcp/dhclient.conf", buffer.Bytes())
+	_, err = net.fs.ConvergeFileContents("/etc/dhcp/dhclient.conf", buffer.Bytes())
 	if err != nil {
 		err = bosherr.WrapError(err, "Writing to /etc/dhcp/dhclient.conf")
 		return
 	}
 
-	if written {
-		// Ignore errors here, just run the commands
-		net.cmdRunner.RunCommand("service", "network", "restart")
-	}
-
 	return
 }
 
@@ -90,48 +150,105 @@ request subnet-mask, broadcast-address, time-offset, routers,
 {{ range .DnsServers }}prepend domain-name-servers {{ . }};
 {{ end }}`
 
-func (net centos) SetupManualNetworking(networks boshsettings.Networks) (err error) {
-	modifiedNetworks, err := net.writeIfcfgs(networks)
-	if err != nil {
-		err = bosherr.WrapError(err, "Writing network interfaces")
-		return
-	}
-
-	net.restartNetwork()
+// gratuitiousArp broadcasts an arping for every known interface address so
+// that upstream switches learn the interface's MAC as soon as possible.
+// Addresses are re-resolved on every iteration since an interface that BOSH
+// did not assign an IP to (e.g. one configured via DHCP) may not have
+// acquired its lease yet. Announcements are skipped when the neighbor cache
+// already shows the IP bound to our own MAC on the expected interface, and a
+// warning is logged when another host appears to be claiming it.
+func (net centos) gratuitiousArp(addresses []boship.InterfaceAddress) {
+	for i := 0; i < 6; i++ {
+		for _, address := range addresses {
+			iface := address.GetInterfaceName()
 
-	err = net.writeResolvConf(networks)
-	if err != nil {
-		err = bosherr.WrapError(err, "Writing resolv.conf")
-		return
-	}
+			for !net.fs.FileExists(filepath.Join("/sys/class/net", iface)) {
+				time.Sleep(100 * time.Millisecond)
+			}
 
-	go net.gratuitiousArp(modifiedNetworks)
+			ip, err := address.Resolve()
+			if err != nil {
+				continue
+			}
 
-	return
-}
+			// Read the MAC now that the interface is known to exist in
+			// sysfs -- a mac snapshotted before the wait loop above could
+			// still be empty for an interface that only just appeared.
+			expectedMac, err := net.interfaceMacAddress(iface)
+			if err != nil {
+				continue
+			}
 
-func (net centos) gratuitiousArp(networks []CustomNetwork) {
-	for i := 0; i < 6; i++ {
-		for _, network := range networks {
-			for !net.fs.FileExists(filepath.Join("/sys/class/net", network.Interface)) {
-				time.Sleep(100 * time.Millisecond)
+			if net.neighborAlreadyCorrect(ip, iface, expectedMac) {
+				continue
 			}
 
-			net.cmdRunner.RunCommand("arping", "-c", "1", "-U", "-I", network.Interface, network.Ip)
+			net.cmdRunner.RunCommand("arping", "-c", "1", "-U", "-I", iface, ip)
 			time.Sleep(net.arpWaitInterval)
 		}
 	}
 	return
 }
 
-func (net centos) writeIfcfgs(networks boshsettings.Networks) (modifiedNetworks []CustomNetwork, err error) {
+func (net centos) interfaceMacAddress(iface string) (string, error) {
+	contents, err := net.fs.ReadFileString(filepath.Join("/sys/class/net", iface, "address"))
+	if err != nil {
+		return "", bosherr.WrapError(err, "Reading mac address from file")
+	}
+
+	return strings.Trim(contents, "\n"), nil
+}
+
+func (net centos) neighborAlreadyCorrect(ip, iface, expectedMac string) bool {
+	mac, neighborIface, err := net.arpCache.Lookup(ip)
+	if err != nil {
+		return false
+	}
+
+	if mac == expectedMac && neighborIface == iface {
+		return true
+	}
+
+	net.logger.Warn(
+		centosNetManagerLogTag,
+		"Detected conflicting neighbor for IP %s: expected mac %s on %s, found mac %s on %s",
+		ip, expectedMac, iface, mac, neighborIface,
+	)
+
+	return false
+}
+
+// buildInterfaceConfigurations binds each network in settings to the ethX
+// name detected on the host (by MAC), splitting them into static and DHCP
+// configurations. Any physical interface (see isPhysicalInterfaceName) present
+// on the host but not mentioned in settings is added as an unmanaged DHCP
+// configuration so it still comes up; loopback and virtual devices are skipped.
+func (net centos) buildInterfaceConfigurations(networks boshsettings.Networks) (staticConfigs []StaticInterfaceConfiguration, dhcpConfigs []DHCPInterfaceConfiguration, err error) {
 	macAddresses, err := net.detectMacAddresses()
 	if err != nil {
 		err = bosherr.WrapError(err, "Detecting mac addresses")
 		return
 	}
 
+	configuredMacAddresses := map[string]bool{}
+
 	for _, aNet := range networks {
+		iface, found := macAddresses[aNet.Mac]
+		if !found {
+			err = bosherr.New("Failed to find interface for mac address '%s'", aNet.Mac)
+			return
+		}
+
+		configuredMacAddresses[aNet.Mac] = true
+
+		if aNet.Ip == "" {
+			dhcpConfigs = append(dhcpConfigs, DHCPInterfaceConfiguration{
+				Name: iface,
+				Mac:  aNet.Mac,
+			})
+			continue
+		}
+
 		var network, broadcast string
 		network, broadcast, err = boshsys.CalculateNetworkAndBroadcast(aNet.Ip, aNet.Netmask)
 		if err != nil {
@@ -139,35 +256,89 @@ func (net centos) writeIfcfgs(networks boshsettings.Networks) (modifiedNetworks
 			return
 		}
 
-		newNet := CustomNetwork{
-			aNet,
-			macAddresses[aNet.Mac],
-			network,
-			broadcast,
-			true,
+		staticConfigs = append(staticConfigs, StaticInterfaceConfiguration{
+			Name:              iface,
+			Network:           network,
+			Netmask:           aNet.Netmask,
+			Broadcast:         broadcast,
+			Ip:                aNet.Ip,
+			Gateway:           aNet.Gateway,
+			HasDefaultGateway: true,
+			Mac:               aNet.Mac,
+		})
+	}
+
+	for mac, iface := range macAddresses {
+		if configuredMacAddresses[mac] || !isPhysicalInterfaceName(iface) {
+			continue
 		}
-		modifiedNetworks = append(modifiedNetworks, newNet)
 
+		dhcpConfigs = append(dhcpConfigs, DHCPInterfaceConfiguration{
+			Name: iface,
+			Mac:  mac,
+		})
+	}
+
+	return
+}
+
+var physicalInterfaceNameRegex = regexp.MustCompile(`^(eth|em|eno|ens|enp)\d`)
+
+// isPhysicalInterfaceName reports whether name looks like a real NIC (using
+// either the legacy ethX scheme or systemd's predictable network interface
+// names) as opposed to loopback or a virtual/tunnel device. Those virtual
+// devices are never absent from settings by accident, so they should not be
+// auto-configured for DHCP or announced via gratuitous ARP.
+func isPhysicalInterfaceName(name string) bool {
+	return physicalInterfaceNameRegex.MatchString(name)
+}
+
+// writeIfcfgs writes an ifcfg-* file for every static and DHCP interface
+// configuration and returns an InterfaceAddress for each one so callers
+// (e.g. gratuitiousArp) can announce them.
+func (net centos) writeIfcfgs(staticConfigs []StaticInterfaceConfiguration, dhcpConfigs []DHCPInterfaceConfiguration) (interfaceAddresses []boship.InterfaceAddress, err error) {
+	for _, config := range staticConfigs {
 		buffer := bytes.NewBuffer([]byte{})
-		t := template.Must(template.New("ifcfg").Parse(CENTOS_IFCFG_TEMPLATE))
+		t := template.Must(template.New("ifcfg-static").Parse(CENTOS_IFCFG_STATIC_TEMPLATE))
 
-		err = t.Execute(buffer, newNet)
+		err = t.Execute(buffer, config)
 		if err != nil {
 			err = bosherr.WrapError(err, "Generating config from template")
 			return
 		}
 
-		err = net.fs.WriteFile(filepath.Join("/etc/sysconfig/network-scripts", "ifcfg-"+newNet.Interface), buffer.Bytes())
+		err = net.fs.WriteFile(filepath.Join("/etc/sysconfig/network-scripts", "ifcfg-"+config.Name), buffer.Bytes())
 		if err != nil {
 			err = bosherr.WrapError(err, "Writing to /etc/sysconfig/network-scripts")
 			return
 		}
+
+		interfaceAddresses = append(interfaceAddresses, boship.NewStaticInterfaceAddress(config.Name, config.Ip))
+	}
+
+	for _, config := range dhcpConfigs {
+		buffer := bytes.NewBuffer([]byte{})
+		t := template.Must(template.New("ifcfg-dhcp").Parse(CENTOS_IFCFG_DHCP_TEMPLATE))
+
+		err = t.Execute(buffer, config)
+		if err != nil {
+			err = bosherr.WrapError(err, "Generating config from template")
+			return
+		}
+
+		err = net.fs.WriteFile(filepath.Join("/etc/sysconfig/network-scripts", "ifcfg-"+config.Name), buffer.Bytes())
+		if err != nil {
+			err = bosherr.WrapError(err, "Writing to /etc/sysconfig/network-scripts")
+			return
+		}
+
+		interfaceAddresses = append(interfaceAddresses, boship.NewResolvingInterfaceAddress(config.Name, net.cmdRunner))
 	}
 
 	return
 }
 
-const CENTOS_IFCFG_TEMPLATE = `DEVICE={{ .Interface }}
+const CENTOS_IFCFG_STATIC_TEMPLATE = `DEVICE={{ .Name }}
 BOOTPROTO=static
 IPADDR={{ .Ip }}
 NETMASK={{ .Netmask }}
@@ -175,13 +346,44 @@ BROADCAST={{ .Broadcast }}
 {{ if .HasDefaultGateway }}GATEWAY={{ .Gateway }}{{ end }}
 ONBOOT=yes`
 
+const CENTOS_IFCFG_DHCP_TEMPLATE = `DEVICE={{ .Name }}
+BOOTPROTO=dhcp
+ONBOOT=yes`
+
+// writeResolvConf writes the configured DNS servers wherever they will
+// actually take effect. On modern CentOS releases /etc/resolv.conf is owned
+// by systemd-resolved or NetworkManager and any direct write to it is
+// silently reverted, so those are detected and written to instead; only
+// when neither is present do we fall back to writing resolv.conf directly.
 func (p centos) writeResolvConf(networks boshsettings.Networks) (err error) {
+	dnsServers := p.getDnsServers(networks)
+
+	switch {
+	case p.fs.FileExists("/run/systemd/resolve/stub-resolv.conf"):
+		err = p.writeSystemdResolvedConf(dnsServers)
+	case p.networkManagerActive():
+		err = p.writeNetworkManagerDnsConf(dnsServers)
+	default:
+		err = p.writeResolvConfDirectly(dnsServers)
+	}
+
+	return
+}
+
+func (p centos) networkManagerActive() bool {
+	stdout, _, err := p.cmdRunner.RunCommand("systemctl", "is-active", "NetworkManager.service")
+	if err != nil {
+		return false
+	}
+
+	return strings.TrimSpace(stdout) == "active"
+}
+
+func (p centos) writeResolvConfDirectly(dnsServers []string) (err error) {
 	buffer := bytes.NewBuffer([]byte{})
 	t := template.Must(template.New("resolv-conf").Parse(CENTOS_RESOLV_CONF_TEMPLATE))
 
-	dnsServers := p.getDnsServers(networks)
-	dnsServersArg := dnsConfigArg{dnsServers}
-	err = t.Execute(buffer, dnsServersArg)
+	err = t.Execute(buffer, dnsConfigArg{dnsServers})
 	if err != nil {
 		err = bosherr.WrapError(err, "Generating config from template")
 		return
@@ -199,6 +401,72 @@ func (p centos) writeResolvConf(networks boshsettings.Networks) (err error) {
 const CENTOS_RESOLV_CONF_TEMPLATE = `{{ range .DnsServers }}nameserver {{ . }}
 {{ end }}`
 
+func (p centos) writeNetworkManagerDnsConf(dnsServers []string) (err error) {
+	buffer := bytes.NewBuffer([]byte{})
+	t := template.Must(template.New("nm-dns-conf").Funcs(dnsTemplateFuncs).Parse(CENTOS_NETWORK_MANAGER_DNS_TEMPLATE))
+
+	err = t.Execute(buffer, dnsConfigArg{dnsServers})
+	if err != nil {
+		err = bosherr.WrapError(err, "Generating config from template")
+		return
+	}
+
+	err = p.fs.WriteFile("/etc/NetworkManager/conf.d/90-bosh-dns.conf", buffer.Bytes())
+	if err != nil {
+		err = bosherr.WrapError(err, "Writing to /etc/NetworkManager/conf.d/90-bosh-dns.conf")
+		return
+	}
+
+	_, _, err = p.cmdRunner.RunCommand("nmcli", "general", "reload")
+	if err != nil {
+		err = bosherr.WrapError(err, "Reloading NetworkManager configuration")
+		return
+	}
+
+	return
+}
+
+const CENTOS_NETWORK_MANAGER_DNS_TEMPLATE = `[global-dns-domain-*]
+servers={{ join .DnsServers "," }}
+`
+
+func (p centos) writeSystemdResolvedConf(dnsServers []string) (err error) {
+	buffer := bytes.NewBuffer([]byte{})
+	t := template.Must(template.New("resolved-conf").Funcs(dnsTemplateFuncs).Parse(CENTOS_SYSTEMD_RESOLVED_TEMPLATE))
+
+	err = t.Execute(buffer, dnsConfigArg{dnsServers})
+	if err != nil {
+		err = bosherr.WrapError(err, "Generating config from template")
+		return
+	}
+
+	err = p.fs.WriteFile("/etc/systemd/resolved.conf.d/bosh.conf", buffer.Bytes())
+	if err != nil {
+		err = bosherr.WrapError(err, "Writing to /etc/systemd/resolved.conf.d/bosh.conf")
+		return
+	}
+
+	_, _, err = p.cmdRunner.RunCommand("systemctl", "restart", "systemd-resolved")
+	if err != nil {
+		err = bosherr.WrapError(err, "Restarting systemd-resolved")
+		return
+	}
+
+	return
+}
+
+const CENTOS_SYSTEMD_RESOLVED_TEMPLATE = `[Resolve]
+DNS={{ join .DnsServers " " }}
+`
+
+type dnsConfigArg struct {
+	DnsServers []string
+}
+
+var dnsTemplateFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
 func (net centos) detectMacAddresses() (addresses map[string]string, err error) {
 	addresses = map[string]string{}
 
@@ -0,0 +1,155 @@
+package net
+
+import (
+	boship "bosh/platform/net/ip"
+	boshsettings "bosh/settings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func buildTestNetworksWithDns(dnsServers []string) boshsettings.Networks {
+	return boshsettings.Networks{
+		"default": boshsettings.Network{
+			Dns: dnsServers,
+		},
+	}
+}
+
+func TestBuildInterfaceConfigurationsSkipsLoopbackAndVirtualDevices(t *testing.T) {
+	fs := newFakeFileSystem()
+	fs.globResults["/sys/class/net/*"] = []string{
+		"/sys/class/net/lo",
+		"/sys/class/net/docker0",
+		"/sys/class/net/eth0",
+	}
+	fs.filesToRead["/sys/class/net/lo/address"] = "00:00:00:00:00:00\n"
+	fs.filesToRead["/sys/class/net/docker0/address"] = "02:42:ac:11:00:01\n"
+	fs.filesToRead["/sys/class/net/eth0/address"] = "aa:bb:cc:dd:ee:ff\n"
+
+	netManager := centos{fs: fs, cmdRunner: newFakeCmdRunner()}
+
+	staticConfigs, dhcpConfigs, err := netManager.buildInterfaceConfigurations(boshsettings.Networks{})
+	assert.NoError(t, err)
+	assert.Empty(t, staticConfigs)
+
+	names := []string{}
+	for _, config := range dhcpConfigs {
+		names = append(names, config.Name)
+	}
+	assert.Equal(t, []string{"eth0"}, names)
+}
+
+func TestWriteResolvConfWritesDirectlyByDefault(t *testing.T) {
+	fs := newFakeFileSystem()
+	netManager := centos{fs: fs, cmdRunner: newFakeCmdRunner()}
+
+	err := netManager.writeResolvConf(buildTestNetworksWithDns([]string{"8.8.8.8", "8.8.4.4"}))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "nameserver 8.8.8.8\nnameserver 8.8.4.4\n", string(fs.writtenFiles["/etc/resolv.conf"]))
+}
+
+func TestWriteResolvConfPrefersSystemdResolvedWhenStubResolvConfPresent(t *testing.T) {
+	fs := newFakeFileSystem()
+	fs.filesToExist["/run/systemd/resolve/stub-resolv.conf"] = true
+	cmdRunner := newFakeCmdRunner()
+	netManager := centos{fs: fs, cmdRunner: cmdRunner}
+
+	err := netManager.writeResolvConf(buildTestNetworksWithDns([]string{"8.8.8.8", "8.8.4.4"}))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "[Resolve]\nDNS=8.8.8.8 8.8.4.4\n", string(fs.writtenFiles["/etc/systemd/resolved.conf.d/bosh.conf"]))
+	assert.True(t, cmdRunner.ranCommand("systemctl", "restart", "systemd-resolved"))
+	assert.Nil(t, fs.writtenFiles["/etc/resolv.conf"])
+}
+
+func TestWriteResolvConfUsesNetworkManagerWhenActive(t *testing.T) {
+	fs := newFakeFileSystem()
+	cmdRunner := newFakeCmdRunner()
+	cmdRunner.AddResult("systemctl is-active NetworkManager.service", fakeCmdResult{stdout: "active\n"})
+	netManager := centos{fs: fs, cmdRunner: cmdRunner}
+
+	err := netManager.writeResolvConf(buildTestNetworksWithDns([]string{"8.8.8.8", "8.8.4.4"}))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "[global-dns-domain-*]\nservers=8.8.8.8,8.8.4.4\n", string(fs.writtenFiles["/etc/NetworkManager/conf.d/90-bosh-dns.conf"]))
+	assert.True(t, cmdRunner.ranCommand("nmcli", "general", "reload"))
+	assert.Nil(t, fs.writtenFiles["/etc/resolv.conf"])
+}
+
+func TestWriteResolvConfSkipsNetworkManagerWhenInactive(t *testing.T) {
+	fs := newFakeFileSystem()
+	cmdRunner := newFakeCmdRunner()
+	cmdRunner.AddResult("systemctl is-active NetworkManager.service", fakeCmdResult{stdout: "inactive\n"})
+	netManager := centos{fs: fs, cmdRunner: cmdRunner}
+
+	err := netManager.writeResolvConf(buildTestNetworksWithDns([]string{"8.8.8.8", "8.8.4.4"}))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "nameserver 8.8.8.8\nnameserver 8.8.4.4\n", string(fs.writtenFiles["/etc/resolv.conf"]))
+}
+
+func buildTestNetManager(fs *fakeFileSystem, cmdRunner *fakeCmdRunner, arpCache *fakeArpCache, logger *fakeLogger) centos {
+	return centos{
+		arpWaitInterval: time.Millisecond,
+		fs:              fs,
+		cmdRunner:       cmdRunner,
+		arpCache:        arpCache,
+		logger:          logger,
+	}
+}
+
+func TestGratuitiousArpSkipsAnnouncementWhenNeighborAlreadyCorrect(t *testing.T) {
+	fs := newFakeFileSystem()
+	fs.filesToExist["/sys/class/net/eth0"] = true
+	fs.filesToRead["/sys/class/net/eth0/address"] = "aa:bb:cc:dd:ee:ff\n"
+
+	cmdRunner := newFakeCmdRunner()
+	arpCache := newFakeArpCache()
+	arpCache.neighbors["10.0.0.5"] = fakeNeighbor{mac: "aa:bb:cc:dd:ee:ff", iface: "eth0"}
+	logger := &fakeLogger{}
+
+	netManager := buildTestNetManager(fs, cmdRunner, arpCache, logger)
+
+	netManager.gratuitiousArp([]boship.InterfaceAddress{boship.NewStaticInterfaceAddress("eth0", "10.0.0.5")})
+
+	assert.False(t, cmdRunner.ranCommand("arping", "-c", "1", "-U", "-I", "eth0", "10.0.0.5"))
+	assert.Empty(t, logger.warnings)
+}
+
+func TestGratuitiousArpWarnsAndStillAnnouncesOnConflictingNeighbor(t *testing.T) {
+	fs := newFakeFileSystem()
+	fs.filesToExist["/sys/class/net/eth0"] = true
+	fs.filesToRead["/sys/class/net/eth0/address"] = "aa:bb:cc:dd:ee:ff\n"
+
+	cmdRunner := newFakeCmdRunner()
+	arpCache := newFakeArpCache()
+	arpCache.neighbors["10.0.0.5"] = fakeNeighbor{mac: "11:22:33:44:55:66", iface: "eth1"}
+	logger := &fakeLogger{}
+
+	netManager := buildTestNetManager(fs, cmdRunner, arpCache, logger)
+
+	netManager.gratuitiousArp([]boship.InterfaceAddress{boship.NewStaticInterfaceAddress("eth0", "10.0.0.5")})
+
+	assert.True(t, cmdRunner.ranCommand("arping", "-c", "1", "-U", "-I", "eth0", "10.0.0.5"))
+	assert.NotEmpty(t, logger.warnings)
+}
+
+func TestGratuitiousArpAnnouncesWhenNoNeighborEntryFound(t *testing.T) {
+	fs := newFakeFileSystem()
+	fs.filesToExist["/sys/class/net/eth0"] = true
+	fs.filesToRead["/sys/class/net/eth0/address"] = "aa:bb:cc:dd:ee:ff\n"
+
+	cmdRunner := newFakeCmdRunner()
+	arpCache := newFakeArpCache()
+	logger := &fakeLogger{}
+
+	netManager := buildTestNetManager(fs, cmdRunner, arpCache, logger)
+
+	netManager.gratuitiousArp([]boship.InterfaceAddress{boship.NewStaticInterfaceAddress("eth0", "10.0.0.5")})
+
+	assert.True(t, cmdRunner.ranCommand("arping", "-c", "1", "-U", "-I", "eth0", "10.0.0.5"))
+	assert.Empty(t, logger.warnings)
+}
@@ -0,0 +1,136 @@
+package net
+
+import (
+	bosharp "bosh/platform/net/arp"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type fakeCmdResult struct {
+	stdout string
+	stderr string
+	err    error
+}
+
+type fakeCmdRunner struct {
+	results map[string]fakeCmdResult
+	cmdsRun [][]string
+}
+
+func newFakeCmdRunner() *fakeCmdRunner {
+	return &fakeCmdRunner{results: map[string]fakeCmdResult{}}
+}
+
+func (r *fakeCmdRunner) AddResult(fullCmd string, result fakeCmdResult) {
+	r.results[fullCmd] = result
+}
+
+func (r *fakeCmdRunner) RunCommand(cmd string, args ...string) (stdout string, stderr string, err error) {
+	full := append([]string{cmd}, args...)
+	r.cmdsRun = append(r.cmdsRun, full)
+
+	result, found := r.results[strings.Join(full, " ")]
+	if !found {
+		return "", "", nil
+	}
+
+	return result.stdout, result.stderr, result.err
+}
+
+func (r *fakeCmdRunner) ranCommand(fullCmd ...string) bool {
+	for _, cmd := range r.cmdsRun {
+		if strings.Join(cmd, " ") == strings.Join(fullCmd, " ") {
+			return true
+		}
+	}
+
+	return false
+}
+
+type fakeFileSystem struct {
+	filesToExist map[string]bool
+	globResults  map[string][]string
+	filesToRead  map[string]string
+	writtenFiles map[string][]byte
+}
+
+func newFakeFileSystem() *fakeFileSystem {
+	return &fakeFileSystem{
+		filesToExist: map[string]bool{},
+		globResults:  map[string][]string{},
+		filesToRead:  map[string]string{},
+		writtenFiles: map[string][]byte{},
+	}
+}
+
+func (fs *fakeFileSystem) FileExists(path string) bool {
+	return fs.filesToExist[path]
+}
+
+func (fs *fakeFileSystem) Glob(pattern string) ([]string, error) {
+	return fs.globResults[pattern], nil
+}
+
+func (fs *fakeFileSystem) ReadFileString(path string) (string, error) {
+	return fs.filesToRead[path], nil
+}
+
+func (fs *fakeFileSystem) WriteFile(path string, content []byte) error {
+	fs.writtenFiles[path] = content
+	return nil
+}
+
+func (fs *fakeFileSystem) ConvergeFileContents(path string, content []byte) (bool, error) {
+	fs.writtenFiles[path] = content
+	return true, nil
+}
+
+type fakeNeighbor struct {
+	mac   string
+	iface string
+	err   error
+}
+
+type fakeArpCache struct {
+	neighbors map[string]fakeNeighbor
+}
+
+func newFakeArpCache() *fakeArpCache {
+	return &fakeArpCache{neighbors: map[string]fakeNeighbor{}}
+}
+
+func (c *fakeArpCache) Lookup(ip string) (mac string, iface string, err error) {
+	neighbor, found := c.neighbors[ip]
+	if !found {
+		return "", "", errors.New("No neighbor entry found for IP '" + ip + "'")
+	}
+
+	return neighbor.mac, neighbor.iface, neighbor.err
+}
+
+func (c *fakeArpCache) Neighbors() []bosharp.Neighbor {
+	neighbors := []bosharp.Neighbor{}
+	for ip, neighbor := range c.neighbors {
+		neighbors = append(neighbors, bosharp.Neighbor{Ip: ip, Mac: neighbor.mac, Interface: neighbor.iface})
+	}
+
+	return neighbors
+}
+
+type fakeLogger struct {
+	warnings []string
+}
+
+func (l *fakeLogger) Debug(tag, msg string, args ...interface{})            {}
+func (l *fakeLogger) DebugWithDetails(tag, msg string, args ...interface{}) {}
+func (l *fakeLogger) Info(tag, msg string, args ...interface{})            {}
+
+func (l *fakeLogger) Warn(tag, msg string, args ...interface{}) {
+	l.warnings = append(l.warnings, fmt.Sprintf(msg, args...))
+}
+
+func (l *fakeLogger) Error(tag, msg string, args ...interface{})            {}
+func (l *fakeLogger) ErrorWithDetails(tag, msg string, args ...interface{}) {}
+func (l *fakeLogger) HeavyDebug(tag, msg string, args ...interface{})       {}
+func (l *fakeLogger) Flush() error                                         { return nil }
@@ -0,0 +1,25 @@
+package ip
+
+// InterfaceAddress represents the IP address bound to a network interface.
+// Implementations may know the address up front (static networking) or may
+// need to ask the kernel for it (e.g. an interface configured via DHCP).
+type InterfaceAddress interface {
+	GetInterfaceName() string
+	Resolve() (string, error)
+}
+
+type staticInterfaceAddress struct {
+	interfaceName string
+	ip            string
+}
+
+func NewStaticInterfaceAddress(interfaceName, ip string) staticInterfaceAddress {
+	return staticInterfaceAddress{
+		interfaceName: interfaceName,
+		ip:            ip,
+	}
+}
+
+func (a staticInterfaceAddress) GetInterfaceName() string { return a.interfaceName }
+
+func (a staticInterfaceAddress) Resolve() (string, error) { return a.ip, nil }
@@ -0,0 +1,68 @@
+package ip
+
+import (
+	"regexp"
+	"time"
+
+	bosherr "bosh/errors"
+	boshsys "bosh/system"
+)
+
+// Overridable by tests so retry/backoff behavior can be exercised without
+// waiting out the real production timing.
+var (
+	resolvingInterfaceAddressMaxAttempts = 50
+	resolvingInterfaceAddressRetryDelay  = 300 * time.Millisecond
+)
+
+var ipAddrShowInetRegex = regexp.MustCompile(`inet ([0-9\.]+)/\d+`)
+
+// resolvingInterfaceAddress resolves the current IP address of an interface
+// that BOSH did not assign an address to itself (e.g. a DHCP interface) by
+// asking the kernel for it. The address may not be present yet (DHCP lease
+// still pending), so Resolve retries with a short backoff.
+type resolvingInterfaceAddress struct {
+	interfaceName string
+	cmdRunner     boshsys.CmdRunner
+}
+
+func NewResolvingInterfaceAddress(interfaceName string, cmdRunner boshsys.CmdRunner) resolvingInterfaceAddress {
+	return resolvingInterfaceAddress{
+		interfaceName: interfaceName,
+		cmdRunner:     cmdRunner,
+	}
+}
+
+func (a resolvingInterfaceAddress) GetInterfaceName() string { return a.interfaceName }
+
+func (a resolvingInterfaceAddress) Resolve() (ip string, err error) {
+	for attempt := 0; attempt < resolvingInterfaceAddressMaxAttempts; attempt++ {
+		ip, err = a.detectIP()
+		if err != nil {
+			return
+		}
+
+		if ip != "" {
+			return
+		}
+
+		time.Sleep(resolvingInterfaceAddressRetryDelay)
+	}
+
+	err = bosherr.New("Failed to resolve IP for interface '%s' after %d attempts", a.interfaceName, resolvingInterfaceAddressMaxAttempts)
+	return
+}
+
+func (a resolvingInterfaceAddress) detectIP() (string, error) {
+	stdout, _, err := a.cmdRunner.RunCommand("ip", "-4", "addr", "show", "dev", a.interfaceName)
+	if err != nil {
+		return "", bosherr.WrapError(err, "Shelling out to ip addr show")
+	}
+
+	matches := ipAddrShowInetRegex.FindStringSubmatch(stdout)
+	if len(matches) < 2 {
+		return "", nil
+	}
+
+	return matches[1], nil
+}
@@ -0,0 +1,113 @@
+package ip
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeCmdRunner struct {
+	results   []fakeCmdResult
+	callCount int
+	cmdsRun   [][]string
+}
+
+type fakeCmdResult struct {
+	stdout string
+	err    error
+}
+
+func (r *fakeCmdRunner) RunCommand(cmd string, args ...string) (stdout string, stderr string, err error) {
+	r.cmdsRun = append(r.cmdsRun, append([]string{cmd}, args...))
+
+	result := r.results[r.callCount]
+	if r.callCount < len(r.results)-1 {
+		r.callCount++
+	}
+
+	return result.stdout, "", result.err
+}
+
+func withFastRetries(maxAttempts int, fn func()) {
+	originalMaxAttempts := resolvingInterfaceAddressMaxAttempts
+	originalRetryDelay := resolvingInterfaceAddressRetryDelay
+
+	resolvingInterfaceAddressMaxAttempts = maxAttempts
+	resolvingInterfaceAddressRetryDelay = time.Millisecond
+
+	defer func() {
+		resolvingInterfaceAddressMaxAttempts = originalMaxAttempts
+		resolvingInterfaceAddressRetryDelay = originalRetryDelay
+	}()
+
+	fn()
+}
+
+func TestResolvingInterfaceAddressResolvesImmediately(t *testing.T) {
+	cmdRunner := &fakeCmdRunner{
+		results: []fakeCmdResult{
+			{stdout: "2: eth0: <BROADCAST>\n    inet 10.0.0.5/24 brd 10.0.0.255 scope global eth0\n"},
+		},
+	}
+
+	addr := NewResolvingInterfaceAddress("eth0", cmdRunner)
+
+	ip, err := addr.Resolve()
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.5", ip)
+	assert.Equal(t, "eth0", addr.GetInterfaceName())
+	assert.Equal(t, 1, len(cmdRunner.cmdsRun))
+}
+
+func TestResolvingInterfaceAddressRetriesUntilAddressAppears(t *testing.T) {
+	withFastRetries(5, func() {
+		cmdRunner := &fakeCmdRunner{
+			results: []fakeCmdResult{
+				{stdout: "2: eth1: <BROADCAST>\n"},
+				{stdout: "2: eth1: <BROADCAST>\n"},
+				{stdout: "2: eth1: <BROADCAST>\n    inet 10.0.0.9/24 brd 10.0.0.255 scope global eth1\n"},
+			},
+		}
+
+		addr := NewResolvingInterfaceAddress("eth1", cmdRunner)
+
+		ip, err := addr.Resolve()
+		assert.NoError(t, err)
+		assert.Equal(t, "10.0.0.9", ip)
+		assert.Equal(t, 3, len(cmdRunner.cmdsRun))
+	})
+}
+
+func TestResolvingInterfaceAddressGivesUpAfterMaxAttempts(t *testing.T) {
+	withFastRetries(3, func() {
+		cmdRunner := &fakeCmdRunner{
+			results: []fakeCmdResult{
+				{stdout: "2: eth2: <BROADCAST>\n"},
+			},
+		}
+
+		addr := NewResolvingInterfaceAddress("eth2", cmdRunner)
+
+		_, err := addr.Resolve()
+		assert.Error(t, err)
+		assert.Equal(t, 3, len(cmdRunner.cmdsRun))
+	})
+}
+
+func TestResolvingInterfaceAddressReturnsCmdError(t *testing.T) {
+	withFastRetries(5, func() {
+		cmdRunner := &fakeCmdRunner{
+			results: []fakeCmdResult{
+				{err: errors.New("no such device")},
+			},
+		}
+
+		addr := NewResolvingInterfaceAddress("eth3", cmdRunner)
+
+		_, err := addr.Resolve()
+		assert.Error(t, err)
+		assert.Equal(t, 1, len(cmdRunner.cmdsRun))
+	})
+}